@@ -0,0 +1,340 @@
+// Copyright 2021 ByteDance Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package skipmap
+
+import (
+	"sync"
+	"sync/atomic"
+	"unsafe"
+
+	"golang.org/x/exp/constraints"
+)
+
+// Map represents a map based on skip list in ascending key order, generic
+// over any ordered key type. It is the type-parameterized counterpart to the
+// hand-written, per-type maps (StringMap, Int64Map, ...): one implementation
+// instantiated for every K/V pair instead of a go:generate-produced file per
+// type. Unlike those maps, a Map's node stores V directly (boxed behind a
+// single *V, set and read atomically) rather than boxing it into an
+// interface{} first, so Store avoids the extra interface-boxing allocation.
+//
+// StringMap is left as its own implementation rather than rewritten as a
+// thin wrapper over Map[string, V]: it carries range/batch/snapshot/bloom/
+// sharding features that Map does not implement, and collapsing it would
+// regress those. Int64Map, which never grew any of those extras, is instead
+// a genuine thin wrapper over Map[int64, V] - see skipmap_int64.go - and is
+// the pattern any future fixed-K/V type should follow unless it specifically
+// needs what only StringMap has. New code with a fixed, known K/V pair and
+// no need for those extras should prefer Map directly.
+type Map[K constraints.Ordered, V any] struct {
+	header *genericNode[K, V]
+	length int64
+}
+
+type genericNode[K constraints.Ordered, V any] struct {
+	key   K
+	value unsafe.Pointer // *V
+	next  []*genericNode[K, V]
+	// prev is the level-0 backward link, maintained alongside next[0] so
+	// that ReverseRange and Iterator.Prev can walk the map without
+	// re-searching from the header - see stringNode.prev.
+	prev  unsafe.Pointer // *genericNode[K, V]
+	mu    sync.Mutex
+	flags bitflag
+}
+
+func newGenericNode[K constraints.Ordered, V any](key K, value V, level int) *genericNode[K, V] {
+	n := &genericNode[K, V]{
+		key:  key,
+		next: make([]*genericNode[K, V], level),
+	}
+	n.storeVal(value)
+	return n
+}
+
+func (n *genericNode[K, V]) storeVal(value V) {
+	atomic.StorePointer(&n.value, unsafe.Pointer(&value))
+}
+
+func (n *genericNode[K, V]) loadVal() V {
+	return *(*V)(atomic.LoadPointer(&n.value))
+}
+
+// cmp return 1 if n is bigger, 0 if equal, else -1.
+func (n *genericNode[K, V]) cmp(key K) int {
+	if n.key > key {
+		return 1
+	} else if n.key == key {
+		return 0
+	}
+	return -1
+}
+
+func (n *genericNode[K, V]) loadNext(i int) *genericNode[K, V] {
+	return (*genericNode[K, V])(atomic.LoadPointer((*unsafe.Pointer)(unsafe.Pointer(&n.next[i]))))
+}
+
+func (n *genericNode[K, V]) storeNext(i int, value *genericNode[K, V]) {
+	atomic.StorePointer((*unsafe.Pointer)(unsafe.Pointer(&n.next[i])), unsafe.Pointer(value))
+}
+
+func (n *genericNode[K, V]) loadPrev() *genericNode[K, V] {
+	return (*genericNode[K, V])(atomic.LoadPointer(&n.prev))
+}
+
+func (n *genericNode[K, V]) storePrev(value *genericNode[K, V]) {
+	atomic.StorePointer(&n.prev, unsafe.Pointer(value))
+}
+
+// NewMap returns an empty Map.
+func NewMap[K constraints.Ordered, V any]() *Map[K, V] {
+	var zeroK K
+	var zeroV V
+	h := newGenericNode[K, V](zeroK, zeroV, maxLevel)
+	h.flags.SetTrue(fullyLinked)
+	return &Map[K, V]{header: h}
+}
+
+func (s *Map[K, V]) findNode(key K, preds, succs *[maxLevel]*genericNode[K, V]) *genericNode[K, V] {
+	x := s.header
+	for i := maxLevel - 1; i >= 0; i-- {
+		succ := x.loadNext(i)
+		for succ != nil && succ.cmp(key) < 0 {
+			x = succ
+			succ = x.loadNext(i)
+		}
+		preds[i] = x
+		succs[i] = succ
+		if succ != nil && succ.cmp(key) == 0 {
+			return succ
+		}
+	}
+	return nil
+}
+
+func (s *Map[K, V]) findNodeDelete(key K, preds, succs *[maxLevel]*genericNode[K, V]) int {
+	lFound, x := -1, s.header
+	for i := maxLevel - 1; i >= 0; i-- {
+		succ := x.loadNext(i)
+		for succ != nil && succ.cmp(key) < 0 {
+			x = succ
+			succ = x.loadNext(i)
+		}
+		preds[i] = x
+		succs[i] = succ
+		if lFound == -1 && succ != nil && succ.cmp(key) == 0 {
+			lFound = i
+		}
+	}
+	return lFound
+}
+
+// unlockNodes releases the lock on each distinct predecessor in preds[0:
+// highestLevel+1], from the highest level down to the base - levels sharing
+// the same predecessor (locked once, during insertion) are only unlocked
+// once. It is shared by every node type that threads a per-node mu through a
+// preds array (StringMap, Map, HashedMap): Go generics can't abstract over
+// "has a mu sync.Mutex field" directly, so callers supply their own unlock
+// closure instead.
+func unlockNodes[T comparable](preds [maxLevel]T, highestLevel int, unlock func(T)) {
+	var prevPred T
+	for i := highestLevel; i >= 0; i-- {
+		if preds[i] != prevPred {
+			unlock(preds[i])
+			prevPred = preds[i]
+		}
+	}
+}
+
+func unlockGeneric[K constraints.Ordered, V any](preds [maxLevel]*genericNode[K, V], highestLevel int) {
+	unlockNodes(preds, highestLevel, func(n *genericNode[K, V]) { n.mu.Unlock() })
+}
+
+// Store sets the value for a key.
+func (s *Map[K, V]) Store(key K, value V) {
+	level := randomLevel()
+	var preds, succs [maxLevel]*genericNode[K, V]
+	for {
+		nodeFound := s.findNode(key, &preds, &succs)
+		if nodeFound != nil {
+			if !nodeFound.flags.Get(marked) {
+				nodeFound.storeVal(value)
+				return
+			}
+			continue
+		}
+
+		var (
+			highestLocked        = -1
+			valid                = true
+			pred, succ, prevPred *genericNode[K, V]
+		)
+		for layer := 0; valid && layer < level; layer++ {
+			pred = preds[layer]
+			succ = succs[layer]
+			if pred != prevPred {
+				pred.mu.Lock()
+				highestLocked = layer
+				prevPred = pred
+			}
+			valid = !pred.flags.Get(marked) && (succ == nil || !succ.flags.Get(marked)) && pred.loadNext(layer) == succ
+		}
+		if !valid {
+			unlockGeneric(preds, highestLocked)
+			continue
+		}
+
+		nn := newGenericNode[K, V](key, value, level)
+		for layer := 0; layer < level; layer++ {
+			nn.next[layer] = succs[layer]
+			preds[layer].storeNext(layer, nn)
+		}
+		// Thread the level-0 backward link. preds[0] is always locked above
+		// (layer 0 is always within [0, level)), so this is safe.
+		nn.storePrev(preds[0])
+		if succs[0] != nil {
+			succs[0].storePrev(nn)
+		}
+		nn.flags.SetTrue(fullyLinked)
+		unlockGeneric(preds, highestLocked)
+		atomic.AddInt64(&s.length, 1)
+		return
+	}
+}
+
+// Load returns the value stored in the map for a key, or the zero value if
+// no value is present. The ok result indicates whether value was found in
+// the map.
+func (s *Map[K, V]) Load(key K) (value V, ok bool) {
+	x := s.header
+	for i := maxLevel - 1; i >= 0; i-- {
+		nex := x.loadNext(i)
+		for nex != nil && nex.cmp(key) < 0 {
+			x = nex
+			nex = x.loadNext(i)
+		}
+		if nex != nil && nex.cmp(key) == 0 {
+			if nex.flags.MGet(fullyLinked|marked, fullyLinked) {
+				return nex.loadVal(), true
+			}
+			var zero V
+			return zero, false
+		}
+	}
+	var zero V
+	return zero, false
+}
+
+// LoadOrStore returns the existing value for the key if present.
+// Otherwise, it stores and returns the given value.
+// The loaded result is true if the value was loaded, false if stored.
+func (s *Map[K, V]) LoadOrStore(key K, value V) (actual V, loaded bool) {
+	loadedVal, ok := s.Load(key)
+	if !ok {
+		s.Store(key, value)
+		return value, false
+	}
+	return loadedVal, true
+}
+
+// LoadAndDelete deletes the value for a key, returning the previous value if any.
+// The loaded result reports whether the key was present.
+func (s *Map[K, V]) LoadAndDelete(key K) (value V, loaded bool) {
+	var (
+		nodeToDelete *genericNode[K, V]
+		isMarked     bool
+		topLayer     = -1
+		preds, succs [maxLevel]*genericNode[K, V]
+	)
+	for {
+		lFound := s.findNodeDelete(key, &preds, &succs)
+		if isMarked ||
+			lFound != -1 && succs[lFound].flags.MGet(fullyLinked|marked, fullyLinked) && (len(succs[lFound].next)-1) == lFound {
+			if !isMarked {
+				nodeToDelete = succs[lFound]
+				topLayer = lFound
+				nodeToDelete.mu.Lock()
+				if nodeToDelete.flags.Get(marked) {
+					nodeToDelete.mu.Unlock()
+					var zero V
+					return zero, false
+				}
+				nodeToDelete.flags.SetTrue(marked)
+				isMarked = true
+			}
+			var (
+				highestLocked        = -1
+				valid                = true
+				pred, succ, prevPred *genericNode[K, V]
+			)
+			for layer := 0; valid && (layer <= topLayer); layer++ {
+				pred, succ = preds[layer], succs[layer]
+				if pred != prevPred {
+					pred.mu.Lock()
+					highestLocked = layer
+					prevPred = pred
+				}
+				valid = !pred.flags.Get(marked) && pred.loadNext(layer) == succ
+			}
+			if !valid {
+				unlockGeneric(preds, highestLocked)
+				continue
+			}
+			for i := topLayer; i >= 0; i-- {
+				preds[i].storeNext(i, nodeToDelete.next[i])
+			}
+			if next0 := nodeToDelete.next[0]; next0 != nil {
+				next0.storePrev(preds[0])
+			}
+			nodeToDelete.mu.Unlock()
+			unlockGeneric(preds, highestLocked)
+			atomic.AddInt64(&s.length, -1)
+			return nodeToDelete.loadVal(), true
+		}
+		var zero V
+		return zero, false
+	}
+}
+
+// Delete deletes the value for a key.
+func (s *Map[K, V]) Delete(key K) {
+	s.LoadAndDelete(key)
+}
+
+// Range calls f sequentially for each key and value present in the map.
+// If f returns false, range stops the iteration.
+//
+// Range does not necessarily correspond to any consistent snapshot of the
+// Map's contents: no key will be visited more than once, but if the value
+// for any key is stored or deleted concurrently, Range may reflect any
+// mapping for that key from any point during the Range call.
+func (s *Map[K, V]) Range(f func(key K, value V) bool) {
+	x := s.header.loadNext(0)
+	for x != nil {
+		if !x.flags.MGet(fullyLinked|marked, fullyLinked) {
+			x = x.loadNext(0)
+			continue
+		}
+		if !f(x.key, x.loadVal()) {
+			break
+		}
+		x = x.loadNext(0)
+	}
+}
+
+// Len return the length of this Map.
+func (s *Map[K, V]) Len() int {
+	return int(atomic.LoadInt64(&s.length))
+}
@@ -0,0 +1,307 @@
+// Copyright 2021 ByteDance Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package skipmap
+
+import (
+	"sync"
+	"sync/atomic"
+	"unsafe"
+)
+
+// HashedMap is the Map counterpart for key types that only support equality,
+// not ordering (e.g. a struct key, or a string-like type you'd rather not
+// compare lexicographically). Entries are ordered by a caller-supplied
+// 64-bit hash of the key.
+//
+// Hash collisions are resolved by chaining: every node sharing a score is
+// always linked at the very front of that score's run, at every level it
+// participates in, so the run stays one contiguous stretch of the list at
+// every level. A lookup descends on score alone (there is no ordering
+// between two different keys that collide) to reach the front of the run,
+// then does a level-0 linear scan across it for the exact key. This is
+// deliberately simpler than trying to give colliding keys a secondary total
+// order: with no ordering relation between distinct colliding keys to
+// maintain, there is nothing for a concurrent Store to get inconsistent
+// about across levels.
+//
+// Range visits keys in hash order, which is not a meaningful order to a
+// caller - use Map if key order matters.
+type HashedMap[K comparable, V any] struct {
+	header *hashedNode[K, V]
+	length int64
+	hashFn func(K) uint64
+}
+
+type hashedNode[K comparable, V any] struct {
+	key   K
+	score uint64
+	value unsafe.Pointer // *V
+	next  []*hashedNode[K, V]
+	mu    sync.Mutex
+	flags bitflag
+}
+
+func newHashedNode[K comparable, V any](key K, score uint64, value V, level int) *hashedNode[K, V] {
+	n := &hashedNode[K, V]{
+		key:   key,
+		score: score,
+		next:  make([]*hashedNode[K, V], level),
+	}
+	n.storeVal(value)
+	return n
+}
+
+func (n *hashedNode[K, V]) storeVal(value V) {
+	atomic.StorePointer(&n.value, unsafe.Pointer(&value))
+}
+
+func (n *hashedNode[K, V]) loadVal() V {
+	return *(*V)(atomic.LoadPointer(&n.value))
+}
+
+func (n *hashedNode[K, V]) loadNext(i int) *hashedNode[K, V] {
+	return (*hashedNode[K, V])(atomic.LoadPointer((*unsafe.Pointer)(unsafe.Pointer(&n.next[i]))))
+}
+
+func (n *hashedNode[K, V]) storeNext(i int, value *hashedNode[K, V]) {
+	atomic.StorePointer((*unsafe.Pointer)(unsafe.Pointer(&n.next[i])), unsafe.Pointer(value))
+}
+
+// NewHashedMap returns an empty HashedMap that hashes keys with hashFn.
+// hashFn must be deterministic for a given key; it need not be
+// collision-free.
+func NewHashedMap[K comparable, V any](hashFn func(K) uint64) *HashedMap[K, V] {
+	var zeroK K
+	var zeroV V
+	h := newHashedNode[K, V](zeroK, 0, zeroV, maxLevel)
+	h.flags.SetTrue(fullyLinked)
+	return &HashedMap[K, V]{header: h, hashFn: hashFn}
+}
+
+// locate descends purely on score to find the front boundary of key's score
+// bucket at every level, then scans the (contiguous, see type doc) bucket at
+// level 0 for an exact key match.
+//
+// If a match is found, preds/succs are corrected level by level so they
+// bracket the matched node exactly, ready for a caller to unlink it. If no
+// match is found, preds/succs bracket the bucket's front boundary, ready for
+// a caller to insert a new node there - which is always correct, because a
+// new node never needs to be ordered relative to other members of the same
+// bucket, only relative to strictly smaller/larger scores.
+func (s *HashedMap[K, V]) locate(score uint64, key K, preds, succs *[maxLevel]*hashedNode[K, V]) *hashedNode[K, V] {
+	x := s.header
+	for i := maxLevel - 1; i >= 0; i-- {
+		succ := x.loadNext(i)
+		for succ != nil && succ.score < score {
+			x = succ
+			succ = x.loadNext(i)
+		}
+		preds[i] = x
+		succs[i] = succ
+	}
+
+	for cur := succs[0]; cur != nil && cur.score == score; cur = cur.loadNext(0) {
+		if cur.key != key {
+			continue
+		}
+		// cur participates in levels [0, len(cur.next)); walk each of those
+		// levels forward from the bucket's front boundary to cur itself. Every
+		// node crossed in doing so is, by the contiguity invariant, another
+		// member of the same bucket, never a node belonging past it.
+		for i := 0; i < len(cur.next); i++ {
+			for succs[i] != cur {
+				preds[i] = succs[i]
+				succs[i] = succs[i].loadNext(i)
+			}
+		}
+		return cur
+	}
+	return nil
+}
+
+func unlockHashed[K comparable, V any](preds [maxLevel]*hashedNode[K, V], highestLevel int) {
+	unlockNodes(preds, highestLevel, func(n *hashedNode[K, V]) { n.mu.Unlock() })
+}
+
+// Store sets the value for a key.
+func (s *HashedMap[K, V]) Store(key K, value V) {
+	score := s.hashFn(key)
+	level := randomLevel()
+	var preds, succs [maxLevel]*hashedNode[K, V]
+	for {
+		nodeFound := s.locate(score, key, &preds, &succs)
+		if nodeFound != nil {
+			if !nodeFound.flags.Get(marked) {
+				nodeFound.storeVal(value)
+				return
+			}
+			continue
+		}
+
+		var (
+			highestLocked        = -1
+			valid                = true
+			pred, succ, prevPred *hashedNode[K, V]
+		)
+		for layer := 0; valid && layer < level; layer++ {
+			pred = preds[layer]
+			succ = succs[layer]
+			if pred != prevPred {
+				pred.mu.Lock()
+				highestLocked = layer
+				prevPred = pred
+			}
+			valid = !pred.flags.Get(marked) && (succ == nil || !succ.flags.Get(marked)) && pred.loadNext(layer) == succ
+		}
+		if !valid {
+			unlockHashed(preds, highestLocked)
+			continue
+		}
+
+		// Always linked at the front of key's bucket: preds/succs here bracket
+		// the bucket's front boundary, never a position within it, so this never
+		// needs to be ordered against other colliding keys.
+		nn := newHashedNode[K, V](key, score, value, level)
+		for layer := 0; layer < level; layer++ {
+			nn.next[layer] = succs[layer]
+			preds[layer].storeNext(layer, nn)
+		}
+		nn.flags.SetTrue(fullyLinked)
+		unlockHashed(preds, highestLocked)
+		atomic.AddInt64(&s.length, 1)
+		return
+	}
+}
+
+// Load returns the value stored in the map for a key, or the zero value if
+// no value is present. The ok result indicates whether value was found in
+// the map.
+func (s *HashedMap[K, V]) Load(key K) (value V, ok bool) {
+	score := s.hashFn(key)
+	x := s.header
+	for i := maxLevel - 1; i >= 0; i-- {
+		succ := x.loadNext(i)
+		for succ != nil && succ.score < score {
+			x = succ
+			succ = x.loadNext(i)
+		}
+	}
+	for cur := x.loadNext(0); cur != nil && cur.score == score; cur = cur.loadNext(0) {
+		if cur.key != key {
+			continue
+		}
+		if cur.flags.MGet(fullyLinked|marked, fullyLinked) {
+			return cur.loadVal(), true
+		}
+		var zero V
+		return zero, false
+	}
+	var zero V
+	return zero, false
+}
+
+// LoadOrStore returns the existing value for the key if present.
+// Otherwise, it stores and returns the given value.
+// The loaded result is true if the value was loaded, false if stored.
+func (s *HashedMap[K, V]) LoadOrStore(key K, value V) (actual V, loaded bool) {
+	loadedVal, ok := s.Load(key)
+	if !ok {
+		s.Store(key, value)
+		return value, false
+	}
+	return loadedVal, true
+}
+
+// LoadAndDelete deletes the value for a key, returning the previous value if any.
+// The loaded result reports whether the key was present.
+func (s *HashedMap[K, V]) LoadAndDelete(key K) (value V, loaded bool) {
+	score := s.hashFn(key)
+	var (
+		nodeToDelete *hashedNode[K, V]
+		isMarked     bool
+		topLayer     = -1
+		preds, succs [maxLevel]*hashedNode[K, V]
+	)
+	for {
+		found := s.locate(score, key, &preds, &succs)
+		if isMarked || (found != nil && found.flags.MGet(fullyLinked|marked, fullyLinked)) {
+			if !isMarked {
+				nodeToDelete = found
+				topLayer = len(nodeToDelete.next) - 1
+				nodeToDelete.mu.Lock()
+				if nodeToDelete.flags.Get(marked) {
+					nodeToDelete.mu.Unlock()
+					var zero V
+					return zero, false
+				}
+				nodeToDelete.flags.SetTrue(marked)
+				isMarked = true
+			}
+			var (
+				highestLocked        = -1
+				valid                = true
+				pred, succ, prevPred *hashedNode[K, V]
+			)
+			for layer := 0; valid && layer <= topLayer; layer++ {
+				pred, succ = preds[layer], succs[layer]
+				if pred != prevPred {
+					pred.mu.Lock()
+					highestLocked = layer
+					prevPred = pred
+				}
+				valid = !pred.flags.Get(marked) && pred.loadNext(layer) == succ
+			}
+			if !valid {
+				unlockHashed(preds, highestLocked)
+				continue
+			}
+			for i := topLayer; i >= 0; i-- {
+				preds[i].storeNext(i, nodeToDelete.next[i])
+			}
+			nodeToDelete.mu.Unlock()
+			unlockHashed(preds, highestLocked)
+			atomic.AddInt64(&s.length, -1)
+			return nodeToDelete.loadVal(), true
+		}
+		var zero V
+		return zero, false
+	}
+}
+
+// Delete deletes the value for a key.
+func (s *HashedMap[K, V]) Delete(key K) {
+	s.LoadAndDelete(key)
+}
+
+// Range calls f sequentially for each key and value present in the map, in
+// hash order. If f returns false, range stops the iteration.
+func (s *HashedMap[K, V]) Range(f func(key K, value V) bool) {
+	x := s.header.loadNext(0)
+	for x != nil {
+		if !x.flags.MGet(fullyLinked|marked, fullyLinked) {
+			x = x.loadNext(0)
+			continue
+		}
+		if !f(x.key, x.loadVal()) {
+			break
+		}
+		x = x.loadNext(0)
+	}
+}
+
+// Len return the length of this HashedMap.
+func (s *HashedMap[K, V]) Len() int {
+	return int(atomic.LoadInt64(&s.length))
+}
@@ -0,0 +1,84 @@
+// Copyright 2021 ByteDance Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package skipmap
+
+import "testing"
+
+// constantHash forces every key through NewHashedMap into the same bucket,
+// so every test against it exercises the collision path.
+func constantHash(string) uint64 { return 42 }
+
+func TestHashedMapCollision(t *testing.T) {
+	m := NewHashedMap[string, int](constantHash)
+
+	// Insert enough colliding keys that, with overwhelming probability across
+	// a few runs, at least one pair lands at different skip-list heights -
+	// the exact condition that made the old before()-based findNode lose
+	// reachability to the lower one.
+	keys := []string{"A", "B", "C", "D", "E", "F", "G", "H"}
+	for i, k := range keys {
+		m.Store(k, i)
+	}
+
+	for i, k := range keys {
+		v, ok := m.Load(k)
+		if !ok {
+			t.Fatalf("Load(%q) = _, false; want true", k)
+		}
+		if v != i {
+			t.Fatalf("Load(%q) = %d; want %d", k, v, i)
+		}
+	}
+
+	if got := m.Len(); got != len(keys) {
+		t.Fatalf("Len() = %d; want %d", got, len(keys))
+	}
+}
+
+func TestHashedMapCollisionDelete(t *testing.T) {
+	m := NewHashedMap[string, int](constantHash)
+	m.Store("A", 1)
+	m.Store("B", 2)
+	m.Store("C", 3)
+
+	m.Delete("B")
+	if _, ok := m.Load("B"); ok {
+		t.Fatalf("Load(%q) after Delete = _, true; want false", "B")
+	}
+	for k, want := range map[string]int{"A": 1, "C": 3} {
+		v, ok := m.Load(k)
+		if !ok || v != want {
+			t.Fatalf("Load(%q) = %d, %v; want %d, true", k, v, ok, want)
+		}
+	}
+	if got := m.Len(); got != 2 {
+		t.Fatalf("Len() = %d; want 2", got)
+	}
+}
+
+func TestHashedMapCollisionOverwrite(t *testing.T) {
+	m := NewHashedMap[string, int](constantHash)
+	m.Store("A", 1)
+	m.Store("B", 2)
+	m.Store("A", 10)
+
+	v, ok := m.Load("A")
+	if !ok || v != 10 {
+		t.Fatalf("Load(%q) = %d, %v; want 10, true", "A", v, ok)
+	}
+	if got := m.Len(); got != 2 {
+		t.Fatalf("Len() = %d; want 2", got)
+	}
+}
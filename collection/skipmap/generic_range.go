@@ -0,0 +1,185 @@
+// Copyright 2021 ByteDance Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package skipmap
+
+import "golang.org/x/exp/constraints"
+
+// seekNode returns the first fully-linked, non-marked node with a key >= key,
+// or nil if there is none. Unlike StringMap.seekNode, this really is a
+// lexical (key-ordered) seek: genericNode.cmp compares K directly, with no
+// hash in between.
+func (s *Map[K, V]) seekNode(key K) *genericNode[K, V] {
+	x := s.header
+	for i := maxLevel - 1; i >= 0; i-- {
+		nex := x.loadNext(i)
+		for nex != nil && nex.cmp(key) < 0 {
+			x = nex
+			nex = x.loadNext(i)
+		}
+		if nex != nil && nex.cmp(key) == 0 {
+			x = nex
+			break
+		}
+		if i == 0 {
+			x = nex
+		}
+	}
+	for x != nil && !x.flags.MGet(fullyLinked|marked, fullyLinked) {
+		x = x.loadNext(0)
+	}
+	return x
+}
+
+// RangeFrom calls f sequentially for each key and value present in the map,
+// starting from the first key >= startKey and continuing in ascending key
+// order. If f returns false, RangeFrom stops the iteration.
+//
+// RangeFrom carries the same consistency caveats as Range.
+func (s *Map[K, V]) RangeFrom(startKey K, f func(key K, value V) bool) {
+	x := s.seekNode(startKey)
+	for x != nil {
+		if !x.flags.MGet(fullyLinked|marked, fullyLinked) {
+			x = x.loadNext(0)
+			continue
+		}
+		if !f(x.key, x.loadVal()) {
+			break
+		}
+		x = x.loadNext(0)
+	}
+}
+
+// RangeBetween calls f sequentially for each key and value present in the
+// map with a key in [lo, hi], in ascending key order. If f returns false,
+// RangeBetween stops the iteration.
+//
+// RangeBetween carries the same consistency caveats as Range.
+func (s *Map[K, V]) RangeBetween(lo, hi K, f func(key K, value V) bool) {
+	x := s.seekNode(lo)
+	for x != nil {
+		if !x.flags.MGet(fullyLinked|marked, fullyLinked) {
+			x = x.loadNext(0)
+			continue
+		}
+		if x.cmp(hi) > 0 {
+			break
+		}
+		if !f(x.key, x.loadVal()) {
+			break
+		}
+		x = x.loadNext(0)
+	}
+}
+
+// ReverseRange calls f sequentially for each key and value present in the
+// map in descending key order. If f returns false, ReverseRange stops the
+// iteration.
+//
+// ReverseRange walks the level-0 backward links, so it costs one initial
+// forward pass to reach the tail.
+func (s *Map[K, V]) ReverseRange(f func(key K, value V) bool) {
+	x := s.header.loadNext(0)
+	if x == nil {
+		return
+	}
+	var tail *genericNode[K, V]
+	for x != nil {
+		if x.flags.MGet(fullyLinked|marked, fullyLinked) {
+			tail = x
+		}
+		x = x.loadNext(0)
+	}
+	for tail != nil && tail != s.header {
+		if !tail.flags.MGet(fullyLinked|marked, fullyLinked) {
+			tail = tail.loadPrev()
+			continue
+		}
+		if !f(tail.key, tail.loadVal()) {
+			break
+		}
+		tail = tail.loadPrev()
+	}
+}
+
+// Iterator walks a Map's entries in ascending key order. It is built on top
+// of the level-0 doubly-linked chain, so Next and Prev are both O(1) once
+// positioned.
+//
+// An Iterator does not hold a lock: like Range, it observes whatever mapping
+// was live at the time each node was visited, not a single consistent
+// snapshot.
+type Iterator[K constraints.Ordered, V any] struct {
+	s   *Map[K, V]
+	cur *genericNode[K, V]
+}
+
+// NewIterator returns an Iterator that is not positioned at any entry:
+// Valid reports false, and Next and Prev leave it unpositioned and return
+// false. Callers must call Seek before reading Key/Value.
+func (s *Map[K, V]) NewIterator() *Iterator[K, V] {
+	return &Iterator[K, V]{s: s}
+}
+
+// Seek positions the iterator at the first entry with a key >= key. It
+// returns the same value as a subsequent call to Valid.
+func (it *Iterator[K, V]) Seek(key K) bool {
+	it.cur = it.s.seekNode(key)
+	return it.Valid()
+}
+
+// Valid reports whether the iterator is positioned at an entry.
+func (it *Iterator[K, V]) Valid() bool {
+	return it.cur != nil
+}
+
+// Key returns the key at the iterator's current position.
+// Key panics if the iterator is not Valid.
+func (it *Iterator[K, V]) Key() K {
+	return it.cur.key
+}
+
+// Value returns the value at the iterator's current position.
+// Value panics if the iterator is not Valid.
+func (it *Iterator[K, V]) Value() V {
+	return it.cur.loadVal()
+}
+
+// Next advances the iterator to the next entry in ascending key order. It
+// returns the same value as a subsequent call to Valid.
+func (it *Iterator[K, V]) Next() bool {
+	for it.cur != nil {
+		it.cur = it.cur.loadNext(0)
+		if it.cur != nil && it.cur.flags.MGet(fullyLinked|marked, fullyLinked) {
+			break
+		}
+	}
+	return it.Valid()
+}
+
+// Prev moves the iterator to the previous entry in ascending key order. It
+// returns the same value as a subsequent call to Valid.
+func (it *Iterator[K, V]) Prev() bool {
+	for it.cur != nil {
+		it.cur = it.cur.loadPrev()
+		if it.cur != nil && it.cur == it.s.header {
+			it.cur = nil
+			break
+		}
+		if it.cur != nil && it.cur.flags.MGet(fullyLinked|marked, fullyLinked) {
+			break
+		}
+	}
+	return it.Valid()
+}
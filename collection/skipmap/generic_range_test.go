@@ -0,0 +1,112 @@
+// Copyright 2021 ByteDance Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package skipmap
+
+import "testing"
+
+// TestInt64MapRangeBetweenIsRealKeyRange checks the gap from the review:
+// Int64Map only got RangeFrom/RangeBetween/ReverseRange/Iterator after
+// StringMap's equivalents shipped without them. Unlike StringMap's, these
+// are backed by Map[int64, V], which orders keys directly rather than by
+// hash, so RangeBetween here really does mean "every key in [lo, hi]".
+func TestInt64MapRangeBetweenIsRealKeyRange(t *testing.T) {
+	s := NewInt64()
+	for i := int64(0); i < 100; i++ {
+		s.Store(i, i)
+	}
+
+	var got []int64
+	s.RangeBetween(10, 20, func(key int64, _ interface{}) bool {
+		got = append(got, key)
+		return true
+	})
+
+	if len(got) != 11 {
+		t.Fatalf("RangeBetween(10, 20) visited %d keys; want 11", len(got))
+	}
+	for i, k := range got {
+		if want := int64(10 + i); k != want {
+			t.Fatalf("RangeBetween(10, 20)[%d] = %d; want %d (ascending key order)", i, k, want)
+		}
+	}
+}
+
+func TestInt64MapRangeFromStartsAtKey(t *testing.T) {
+	s := NewInt64()
+	for i := int64(0); i < 10; i++ {
+		s.Store(i, i)
+	}
+
+	var got []int64
+	s.RangeFrom(5, func(key int64, _ interface{}) bool {
+		got = append(got, key)
+		return true
+	})
+
+	want := []int64{5, 6, 7, 8, 9}
+	if len(got) != len(want) {
+		t.Fatalf("RangeFrom(5) visited %d keys; want %d", len(got), len(want))
+	}
+	for i, k := range got {
+		if k != want[i] {
+			t.Fatalf("RangeFrom(5)[%d] = %d; want %d", i, k, want[i])
+		}
+	}
+}
+
+func TestInt64MapReverseRangeIsDescending(t *testing.T) {
+	s := NewInt64()
+	for i := int64(0); i < 10; i++ {
+		s.Store(i, i)
+	}
+
+	var got []int64
+	s.ReverseRange(func(key int64, _ interface{}) bool {
+		got = append(got, key)
+		return true
+	})
+
+	for i, k := range got {
+		if want := int64(9 - i); k != want {
+			t.Fatalf("ReverseRange()[%d] = %d; want %d (descending key order)", i, k, want)
+		}
+	}
+}
+
+func TestInt64MapIteratorWalksAscending(t *testing.T) {
+	s := NewInt64()
+	for i := int64(0); i < 10; i++ {
+		s.Store(i, i)
+	}
+
+	it := s.NewIterator()
+	if !it.Seek(3) {
+		t.Fatalf("Seek(3) = false; want true")
+	}
+	var got []int64
+	for it.Valid() {
+		got = append(got, it.Key())
+		it.Next()
+	}
+	want := []int64{3, 4, 5, 6, 7, 8, 9}
+	if len(got) != len(want) {
+		t.Fatalf("iterator visited %d keys; want %d", len(got), len(want))
+	}
+	for i, k := range got {
+		if k != want[i] {
+			t.Fatalf("iterator[%d] = %d; want %d", i, k, want[i])
+		}
+	}
+}
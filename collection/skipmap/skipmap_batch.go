@@ -0,0 +1,323 @@
+// Copyright 2021 ByteDance Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package skipmap
+
+import (
+	"runtime"
+	"sort"
+	"sync/atomic"
+)
+
+// BatchReplay receives the individual operations recorded in a Batch, in the
+// order they were added, when the Batch is replayed via Batch.Replay.
+type BatchReplay interface {
+	Put(key string, value interface{})
+	Delete(key string)
+	// CompareAndSwap replays a conditional op recorded via Batch.CompareAndSwap.
+	// Its result is discarded by Replay; a target that cares whether the swap
+	// took should call StringMap.CompareAndSwap directly instead of going
+	// through a Batch.
+	CompareAndSwap(key string, old, new interface{}) bool
+}
+
+type batchOpKind int
+
+const (
+	batchOpPut batchOpKind = iota
+	batchOpDelete
+	batchOpCompareAndSwap
+)
+
+type batchOp struct {
+	key   string
+	value interface{}
+	old   interface{} // only set for batchOpCompareAndSwap
+	kind  batchOpKind
+}
+
+// Batch is a sequence of Put/Delete/CompareAndSwap operations that can be
+// applied to a StringMap as a single logical operation. A Batch is not safe
+// for concurrent use.
+type Batch struct {
+	ops []batchOp
+}
+
+// Put appends a set of key to value to the batch.
+func (b *Batch) Put(key string, value interface{}) {
+	b.ops = append(b.ops, batchOp{key: key, value: value, kind: batchOpPut})
+}
+
+// Delete appends a deletion of key to the batch.
+func (b *Batch) Delete(key string) {
+	b.ops = append(b.ops, batchOp{key: key, kind: batchOpDelete})
+}
+
+// CompareAndSwap appends a conditional set of key to new, taking effect only
+// if key's value is old at the point this op executes within the batch.
+// Unlike Put/Delete, Apply always runs this op through StringMap's own
+// CompareAndSwap rather than the hinted fast path, since its result depends
+// on a value comparison findNodeFrom's preds/succs don't carry.
+func (b *Batch) CompareAndSwap(key string, old, new interface{}) {
+	b.ops = append(b.ops, batchOp{key: key, value: new, old: old, kind: batchOpCompareAndSwap})
+}
+
+// Len returns the number of operations recorded in the batch.
+func (b *Batch) Len() int {
+	return len(b.ops)
+}
+
+// Reset clears the batch so it can be reused.
+func (b *Batch) Reset() {
+	b.ops = b.ops[:0]
+}
+
+// Replay plays the batch, in order, against r.
+func (b *Batch) Replay(r BatchReplay) {
+	for _, op := range b.ops {
+		switch op.kind {
+		case batchOpDelete:
+			r.Delete(op.key)
+		case batchOpCompareAndSwap:
+			r.CompareAndSwap(op.key, op.old, op.value)
+		default:
+			r.Put(op.key, op.value)
+		}
+	}
+}
+
+// Apply inserts and deletes every entry recorded in b as a single pass over
+// the skip list: b's entries are sorted by (score, key) - stably, so that if
+// b has more than one op for the same key, they keep executing in the order
+// they were added to b, same as Replay - then the map is walked once with
+// each entry's own preds/succs reused as the starting point for the next
+// entry's search instead of restarting from the header, so a batch of N
+// ordered Put/Delete calls costs roughly O(N + log M) node traversals rather
+// than N independent Store/Delete calls. CompareAndSwap ops skip this fast
+// path: their outcome depends on a value comparison the hint doesn't carry,
+// so they run through StringMap.CompareAndSwap directly, and reset the hint
+// for the following op to the header.
+func (s *StringMap) Apply(b *Batch) {
+	if len(b.ops) == 0 {
+		return
+	}
+	ops := make([]batchOp, len(b.ops))
+	copy(ops, b.ops)
+	sort.SliceStable(ops, func(i, j int) bool {
+		si, sj := hash(ops[i].key), hash(ops[j].key)
+		if si != sj {
+			return si < sj
+		}
+		return ops[i].key < ops[j].key
+	})
+
+	var hint [maxLevel]*stringNode
+	for _, op := range ops {
+		switch op.kind {
+		case batchOpDelete:
+			hint = s.applyDelete(hint, op.key)
+		case batchOpCompareAndSwap:
+			s.CompareAndSwap(op.key, op.old, op.value)
+			hint = [maxLevel]*stringNode{}
+		default:
+			hint = s.applyStore(hint, op.key, op.value)
+		}
+	}
+}
+
+// applyStore is Store, except the initial search is seeded with hint instead
+// of starting from the header. It returns the preds that bracket key, for
+// the next op in the batch to use as its own hint.
+func (s *StringMap) applyStore(hint [maxLevel]*stringNode, key string, value interface{}) [maxLevel]*stringNode {
+	level := randomLevel()
+	for {
+		var preds, succs [maxLevel]*stringNode
+		nodeFound := s.findNodeFrom(hint, key, &preds, &succs)
+		if nodeFound != nil {
+			if !nodeFound.flags.Get(marked) {
+				nodeFound.storeVal(value)
+				return preds
+			}
+			if atomic.LoadUint64(&nodeFound.delSeq) != 0 {
+				s.reclaim()
+			} else {
+				runtime.Gosched()
+			}
+			continue
+		}
+
+		var (
+			highestLocked        = -1
+			valid                = true
+			pred, succ, prevPred *stringNode
+		)
+		for layer := 0; valid && layer < level; layer++ {
+			pred = preds[layer]
+			succ = succs[layer]
+			if pred != prevPred {
+				pred.mu.Lock()
+				highestLocked = layer
+				prevPred = pred
+			}
+			valid = !pred.flags.Get(marked) && (succ == nil || !succ.flags.Get(marked)) && pred.loadNext(layer) == succ
+		}
+		if !valid {
+			unlockString(preds, highestLocked)
+			continue
+		}
+
+		nn := newStringNode(key, value, level)
+		nn.seq = s.nextSeq()
+		// Same ordering as StringMap.Store, and for the same reason: hold
+		// bl's read lock from setting this key's bit through nn actually
+		// becoming linked, so a concurrent resize can't rebuild its bit
+		// array from a Range that misses nn.
+		bl := s.loadBloom()
+		if bl != nil {
+			bl.mu.RLock()
+			bl.addLocked(key)
+		}
+		for layer := 0; layer < level; layer++ {
+			nn.next[layer] = succs[layer]
+			preds[layer].storeNext(layer, nn)
+		}
+		nn.storePrev(preds[0])
+		if succs[0] != nil {
+			succs[0].storePrev(nn)
+		}
+		nn.flags.SetTrue(fullyLinked)
+		unlockString(preds, highestLocked)
+		atomic.AddInt64(&s.length, 1)
+		if bl != nil {
+			bl.mu.RUnlock()
+			atomic.AddUint64(&bl.inserted, 1)
+			s.maybeResizeBloom(bl)
+		}
+		return preds
+	}
+}
+
+// applyDelete is Delete, except the initial search is seeded with hint
+// instead of starting from the header. It returns the preds that bracket
+// key, for the next op in the batch to use as its own hint - on the
+// already-absent path, hint is returned unchanged since nothing below it
+// was disturbed.
+func (s *StringMap) applyDelete(hint [maxLevel]*stringNode, key string) [maxLevel]*stringNode {
+	var (
+		nodeToDelete *stringNode
+		isMarked     bool
+		topLayer     = -1
+		preds, succs [maxLevel]*stringNode
+	)
+	for {
+		lFound := s.findNodeDeleteFrom(hint, key, &preds, &succs)
+		if isMarked ||
+			lFound != -1 && succs[lFound].flags.MGet(fullyLinked|marked, fullyLinked) && (len(succs[lFound].next)-1) == lFound {
+			if !isMarked {
+				nodeToDelete = succs[lFound]
+				topLayer = lFound
+				nodeToDelete.mu.Lock()
+				if nodeToDelete.flags.Get(marked) {
+					nodeToDelete.mu.Unlock()
+					return preds
+				}
+				nodeToDelete.flags.SetTrue(marked)
+				isMarked = true
+				if s.hasLiveSnapshot() {
+					atomic.StoreUint64(&nodeToDelete.delSeq, s.nextSeq())
+					nodeToDelete.mu.Unlock()
+					atomic.AddInt64(&s.length, -1)
+					return preds
+				}
+			}
+			var (
+				highestLocked        = -1
+				valid                = true
+				pred, succ, prevPred *stringNode
+			)
+			for layer := 0; valid && layer <= topLayer; layer++ {
+				pred, succ = preds[layer], succs[layer]
+				if pred != prevPred {
+					pred.mu.Lock()
+					highestLocked = layer
+					prevPred = pred
+				}
+				valid = !pred.flags.Get(marked) && pred.loadNext(layer) == succ
+			}
+			if !valid {
+				unlockString(preds, highestLocked)
+				continue
+			}
+			for i := topLayer; i >= 0; i-- {
+				preds[i].storeNext(i, nodeToDelete.next[i])
+			}
+			if next0 := nodeToDelete.next[0]; next0 != nil {
+				next0.storePrev(preds[0])
+			}
+			nodeToDelete.mu.Unlock()
+			unlockString(preds, highestLocked)
+			atomic.AddInt64(&s.length, -1)
+			return preds
+		}
+		return hint
+	}
+}
+
+// findNodeFrom is findNode, except each level's scan starts at hint[i]
+// instead of the header when hint[i] is non-nil. hint is expected to be the
+// preds array returned for a key no greater than key, which remains a valid
+// (if possibly stale) lower bound to resume scanning from at every level.
+func (s *StringMap) findNodeFrom(hint [maxLevel]*stringNode, key string, preds, succs *[maxLevel]*stringNode) *stringNode {
+	score := hash(key)
+	x := s.header
+	for i := maxLevel - 1; i >= 0; i-- {
+		if hint[i] != nil {
+			x = hint[i]
+		}
+		succ := x.loadNext(i)
+		for succ != nil && succ.cmp(score, key) < 0 {
+			x = succ
+			succ = x.loadNext(i)
+		}
+		preds[i] = x
+		succs[i] = succ
+		if succ != nil && succ.cmp(score, key) == 0 {
+			return succ
+		}
+	}
+	return nil
+}
+
+// findNodeDeleteFrom is findNodeDelete, except each level's scan starts at
+// hint[i] instead of the header when hint[i] is non-nil - see findNodeFrom.
+func (s *StringMap) findNodeDeleteFrom(hint [maxLevel]*stringNode, key string, preds, succs *[maxLevel]*stringNode) int {
+	score := hash(key)
+	lFound, x := -1, s.header
+	for i := maxLevel - 1; i >= 0; i-- {
+		if hint[i] != nil {
+			x = hint[i]
+		}
+		succ := x.loadNext(i)
+		for succ != nil && succ.cmp(score, key) < 0 {
+			x = succ
+			succ = x.loadNext(i)
+		}
+		preds[i] = x
+		succs[i] = succ
+		if lFound == -1 && succ != nil && succ.cmp(score, key) == 0 {
+			lFound = i
+		}
+	}
+	return lFound
+}
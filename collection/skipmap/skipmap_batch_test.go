@@ -0,0 +1,93 @@
+// Copyright 2021 ByteDance Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package skipmap
+
+import "testing"
+
+// replayMap is a minimal BatchReplay that just plays ops back against a
+// StringMap, for comparing against Apply on the same underlying type.
+type replayMap struct {
+	s *StringMap
+}
+
+func (r replayMap) Put(key string, value interface{}) { r.s.Store(key, value) }
+func (r replayMap) Delete(key string)                 { r.s.Delete(key) }
+func (r replayMap) CompareAndSwap(key string, old, new interface{}) bool {
+	return r.s.CompareAndSwap(key, old, new)
+}
+
+// TestApplyMatchesReplayForRepeatedKey covers the ordering bug from review:
+// a batch with more than one op on the same key must produce the same final
+// state whether it goes through Apply or Replay, which requires sorting the
+// ops stably so same-key ops keep their relative order.
+func TestApplyMatchesReplayForRepeatedKey(t *testing.T) {
+	var b Batch
+	b.Put("k", 1)
+	b.Delete("k")
+	b.Put("k", 2)
+
+	applied := NewString()
+	applied.Apply(&b)
+
+	replayed := NewString()
+	b.Replay(replayMap{s: replayed})
+
+	av, aok := applied.Load("k")
+	rv, rok := replayed.Load("k")
+	if aok != rok || av != rv {
+		t.Fatalf("Apply result (%v, %v) != Replay result (%v, %v) for a repeated-key batch", av, aok, rv, rok)
+	}
+	if !aok || av != 2 {
+		t.Fatalf("Load(%q) after Apply = %v, %v; want 2, true", "k", av, aok)
+	}
+}
+
+// TestApplyCompareAndSwap checks Batch.CompareAndSwap actually takes effect
+// through Apply, and leaves the value alone when the precondition doesn't
+// hold.
+func TestApplyCompareAndSwap(t *testing.T) {
+	s := NewString()
+	s.Store("k", "v1")
+
+	var b Batch
+	b.CompareAndSwap("k", "wrong", "v2")
+	b.CompareAndSwap("k", "v1", "v3")
+	s.Apply(&b)
+
+	v, ok := s.Load("k")
+	if !ok || v != "v3" {
+		t.Fatalf("Load(%q) after Apply = %v, %v; want v3, true", "k", v, ok)
+	}
+}
+
+// TestApplyUsesHintAcrossOps is a smoke test that Apply still produces a
+// correct result across many distinct keys, independent of the order they
+// were added to the batch in.
+func TestApplyUsesHintAcrossOps(t *testing.T) {
+	s := NewString()
+	var b Batch
+	for i := 0; i < 50; i++ {
+		b.Put(string(rune('a'+i%26))+string(rune('A'+i/26)), i)
+	}
+	b.Delete("aA")
+	s.Apply(&b)
+
+	if _, ok := s.Load("aA"); ok {
+		t.Fatalf("Load(%q) after deleting batch = _, true; want false", "aA")
+	}
+	if got, want := s.Len(), 49; got != want {
+		t.Fatalf("Len() = %d; want %d", got, want)
+	}
+}
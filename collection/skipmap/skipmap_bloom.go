@@ -0,0 +1,187 @@
+// Copyright 2021 ByteDance Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package skipmap
+
+import (
+	"sync"
+	"sync/atomic"
+	"unsafe"
+)
+
+const (
+	stringBloomBitsPerKey = 8 // bit array size, proportional to the expected key count
+	stringBloomK          = 4 // probes per Load/Store, derived from two halves of one hash
+	stringBloomMaxLoad    = 7 // resize once inserted/m exceeds this / 10
+)
+
+// stringBloom is a fixed-false-positive-rate membership filter guarding
+// negative StringMap.Load calls: a miss here means the key is definitely
+// absent, so Load can skip the skip-list traversal entirely.
+//
+// Unlike a textbook counting Bloom filter, bits are never cleared on
+// delete. That's intentional, not an oversight: a stale set bit can only
+// produce a false positive, which Load already handles by falling through
+// to the real lookup. Clearing bits on delete would require per-bit
+// reference counts for no benefit here, since false negatives (the one
+// thing we can't tolerate) never result from leaving bits set.
+type stringBloom struct {
+	mu       sync.RWMutex // guards bits/m/k during resize; add/mayContain only need it for that, not for coordination with each other
+	bits     []uint64
+	m        uint64
+	k        int
+	inserted uint64
+}
+
+func newStringBloom(expectedN int) *stringBloom {
+	if expectedN < 1 {
+		expectedN = 1
+	}
+	m := uint64(expectedN) * stringBloomBitsPerKey
+	if m < 64 {
+		m = 64
+	}
+	return &stringBloom{
+		bits: make([]uint64, (m+63)/64),
+		m:    m,
+		k:    stringBloomK,
+	}
+}
+
+// splitHash derives two independent-enough hashes from the map's existing
+// wyhash.Sum64String, as the upper and lower 32 bits, so probing doesn't
+// need a second hash function.
+func splitHash(key string) (uint64, uint64) {
+	h := hash(key)
+	return h >> 32, h & 0xffffffff
+}
+
+func setBitAtomic(words []uint64, idx uint64) {
+	w, bit := idx/64, uint64(1)<<(idx%64)
+	for {
+		old := atomic.LoadUint64(&words[w])
+		if old&bit != 0 {
+			return
+		}
+		if atomic.CompareAndSwapUint64(&words[w], old, old|bit) {
+			return
+		}
+	}
+}
+
+func testBitAtomic(words []uint64, idx uint64) bool {
+	w, bit := idx/64, uint64(1)<<(idx%64)
+	return atomic.LoadUint64(&words[w])&bit != 0
+}
+
+// addLocked records key's membership, assuming the caller already holds
+// b.mu for reading. Store calls this directly, rather than through add,
+// so it can keep holding that read lock until the node it's adding a bit
+// for is actually linked into the map - see the comment in StringMap.Store
+// - instead of releasing it right after the bits are set.
+func (b *stringBloom) addLocked(key string) {
+	h1, h2 := splitHash(key)
+	for i := 0; i < b.k; i++ {
+		setBitAtomic(b.bits, (h1+uint64(i)*h2)%b.m)
+	}
+}
+
+// add records key's membership. It may run concurrently with mayContain and
+// with other adds; it only excludes a resize.
+func (b *stringBloom) add(key string) {
+	b.mu.RLock()
+	b.addLocked(key)
+	b.mu.RUnlock()
+	atomic.AddUint64(&b.inserted, 1)
+}
+
+// mayContain reports whether key might be in the map. false is definitive;
+// true means "check the skip list".
+func (b *stringBloom) mayContain(key string) bool {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	h1, h2 := splitHash(key)
+	for i := 0; i < b.k; i++ {
+		if !testBitAtomic(b.bits, (h1+uint64(i)*h2)%b.m) {
+			return false
+		}
+	}
+	return true
+}
+
+// loadBloom returns s's bloom filter, or nil if none is attached.
+func (s *StringMap) loadBloom() *stringBloom {
+	return (*stringBloom)(atomic.LoadPointer(&s.bloom))
+}
+
+// NewStringWithBloom returns an empty StringMap guarded by a Bloom filter
+// sized for roughly expectedN entries. The filter cuts the cost of Load
+// calls that miss (e.g. cache-existence checks) at the expense of a small,
+// resizable bit array that every Store of a new key sets bits in. Delete
+// leaves the filter unchanged: a deleted key's bits stay set until a resize
+// rebuilds the array from the keys then present.
+func NewStringWithBloom(expectedN int) *StringMap {
+	s := NewString()
+	atomic.StorePointer(&s.bloom, unsafe.Pointer(newStringBloom(expectedN)))
+	return s
+}
+
+// DisableBloom detaches s's Bloom filter, if any. Subsequent Load calls go
+// straight to the skip list.
+func (s *StringMap) DisableBloom() {
+	atomic.StorePointer(&s.bloom, nil)
+}
+
+// maybeResizeBloom doubles b's bit array, and rehashes every key currently
+// in s into it, once the load factor crosses stringBloomMaxLoad/10. The
+// rehash walks s.Range under b's write lock, so concurrent add/mayContain
+// calls block for the duration - that's the "resize under a write lock"
+// this filter is built around, traded for not having to coordinate the
+// resize with Store/Delete themselves.
+//
+// This rebuild-and-replace only sees a consistent picture of s because
+// Store/applyStore hold b's read lock across the whole span from setting a
+// new key's bit to actually linking its node into the map, not just while
+// touching bits: the write lock below can't be acquired until every such
+// in-flight insert has finished linking, so this Range can never observe a
+// bit that was set for a node it then fails to find. Replacing b.bits
+// wholesale (instead of merging into it) is only safe because of that -
+// bit positions depend on m, which is changing here, so an old bit can't be
+// OR'd into the new array at the same index anyway.
+func (s *StringMap) maybeResizeBloom(b *stringBloom) {
+	b.mu.RLock()
+	shouldResize := atomic.LoadUint64(&b.inserted)*10 > b.m*stringBloomMaxLoad
+	b.mu.RUnlock()
+	if !shouldResize {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.inserted*10 <= b.m*stringBloomMaxLoad {
+		return // another goroutine already resized
+	}
+	newM := b.m * 2
+	newBits := make([]uint64, (newM+63)/64)
+	s.Range(func(key string, _ interface{}) bool {
+		h1, h2 := splitHash(key)
+		for i := 0; i < b.k; i++ {
+			setBitAtomic(newBits, (h1+uint64(i)*h2)%newM)
+		}
+		return true
+	})
+	b.bits = newBits
+	b.m = newM
+	b.inserted = uint64(s.Len())
+}
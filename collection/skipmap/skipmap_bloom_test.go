@@ -0,0 +1,109 @@
+// Copyright 2021 ByteDance Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package skipmap
+
+import (
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+// TestBloomNoFalseNegativeUnderConcurrentStoreLoad exercises the race the
+// review flagged: Store used to link a node into the list, release its
+// locks, and only then record the key in the bloom filter, leaving a window
+// where a concurrent Load could see the key as definitely absent even
+// though it was already live and reachable. Repeatedly Store fresh keys from
+// one goroutine while other goroutines hammer Load for those same keys;
+// under the old ordering this flakes quickly (especially with -race, which
+// widens the window), and never should once add happens before the node is
+// linked in.
+func TestBloomNoFalseNegativeUnderConcurrentStoreLoad(t *testing.T) {
+	s := NewStringWithBloom(64)
+	const rounds = 500
+	const loaders = 4
+
+	var falseNegatives int64
+	var wg sync.WaitGroup
+	stop := make(chan struct{})
+
+	for i := 0; i < loaders; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				s.Range(func(key string, value interface{}) bool {
+					if _, ok := s.Load(key); !ok {
+						atomic.AddInt64(&falseNegatives, 1)
+					}
+					return true
+				})
+			}
+		}()
+	}
+
+	for i := 0; i < rounds; i++ {
+		s.Store("k"+strconv.Itoa(i), i)
+	}
+	close(stop)
+	wg.Wait()
+
+	if n := atomic.LoadInt64(&falseNegatives); n != 0 {
+		t.Fatalf("Load returned false for %d keys that Range found live - bloom filter produced a false negative", n)
+	}
+}
+
+// TestBloomNoFalseNegativeAcrossConcurrentResize targets the race from
+// review: maybeResizeBloom rebuilds its bit array from scratch via s.Range
+// and replaces b.bits wholesale, so a Store that set its key's bit but
+// hadn't yet linked its node when a concurrent resize's Range ran would
+// have its bit silently dropped. Store many keys concurrently from several
+// goroutines with a bloom sized to force repeated resizes along the way,
+// then check every stored key is still found by Load afterward.
+func TestBloomNoFalseNegativeAcrossConcurrentResize(t *testing.T) {
+	s := NewStringWithBloom(4) // tiny initial size forces resizes almost immediately
+	const perGoroutine = 300
+	const writers = 8
+
+	var wg sync.WaitGroup
+	for g := 0; g < writers; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < perGoroutine; i++ {
+				s.Store("g"+strconv.Itoa(g)+"k"+strconv.Itoa(i), i)
+			}
+		}(g)
+	}
+	wg.Wait()
+
+	var missing int
+	for g := 0; g < writers; g++ {
+		for i := 0; i < perGoroutine; i++ {
+			key := "g" + strconv.Itoa(g) + "k" + strconv.Itoa(i)
+			if _, ok := s.Load(key); !ok {
+				missing++
+			}
+		}
+	}
+	if missing != 0 {
+		t.Fatalf("%d of %d stored keys were not found by Load after concurrent Store/resize - bloom filter lost a bit across a resize", missing, writers*perGoroutine)
+	}
+}
@@ -0,0 +1,31 @@
+// Copyright 2021 ByteDance Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package skipmap
+
+// Int64Map is the int64-keyed counterpart to StringMap. Unlike StringMap,
+// it never grew its own range/batch/snapshot/bloom extras, so unlike
+// StringMap it is a genuine thin wrapper over Map[int64, V] rather than a
+// hand-written copy of the skip-list plumbing - the per-type duplication
+// Map/HashedMap exist to avoid in the first place. It inherits Map's
+// RangeFrom/RangeBetween/ReverseRange/Iterator for free, and - unlike
+// StringMap's versions of the same methods - they really follow key order
+// (ascending, or descending for ReverseRange), since Map orders int64 keys
+// directly rather than by hash.
+type Int64Map = Map[int64, interface{}]
+
+// NewInt64 returns an empty Int64Map.
+func NewInt64() *Int64Map {
+	return NewMap[int64, interface{}]()
+}
@@ -0,0 +1,221 @@
+// Copyright 2021 ByteDance Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package skipmap
+
+// ShardedString holds a fixed number of independent StringMaps and dispatches
+// each key to one of them by its hash, so that concurrent writers to
+// different keys rarely contend on the same skip list header. This trades
+// away the single ordered view of a StringMap: use a plain StringMap when
+// RangeFrom/RangeBetween/ReverseRange ordering across the whole map matters.
+type ShardedString struct {
+	shift  uint
+	shards []*StringMap
+}
+
+// NewShardedString returns a ShardedString with at least `shards` inner
+// StringMap instances. The actual shard count is rounded up to the next
+// power of two, so that dispatch can use a plain bit shift of the key's hash
+// instead of a modulo.
+func NewShardedString(shards int) *ShardedString {
+	if shards < 1 {
+		shards = 1
+	}
+	k := 0
+	for (1 << k) < shards {
+		k++
+	}
+	ss := &ShardedString{
+		shift:  64 - uint(k),
+		shards: make([]*StringMap, 1<<k),
+	}
+	for i := range ss.shards {
+		ss.shards[i] = NewString()
+	}
+	return ss
+}
+
+// shardFor returns the inner StringMap that owns key.
+func (s *ShardedString) shardFor(key string) *StringMap {
+	return s.shards[hash(key)>>s.shift]
+}
+
+// Store sets the value for a key.
+func (s *ShardedString) Store(key string, value interface{}) {
+	s.shardFor(key).Store(key, value)
+}
+
+// Load returns the value stored in the map for a key, or nil if no
+// value is present.
+// The ok result indicates whether value was found in the map.
+func (s *ShardedString) Load(key string) (value interface{}, ok bool) {
+	return s.shardFor(key).Load(key)
+}
+
+// LoadOrStore returns the existing value for the key if present.
+// Otherwise, it stores and returns the given value.
+// The loaded result is true if the value was loaded, false if stored.
+func (s *ShardedString) LoadOrStore(key string, value interface{}) (actual interface{}, loaded bool) {
+	return s.shardFor(key).LoadOrStore(key, value)
+}
+
+// LoadAndDelete deletes the value for a key, returning the previous value if any.
+// The loaded result reports whether the key was present.
+func (s *ShardedString) LoadAndDelete(key string) (value interface{}, loaded bool) {
+	return s.shardFor(key).LoadAndDelete(key)
+}
+
+// Delete deletes the value for a key.
+func (s *ShardedString) Delete(key string) {
+	s.shardFor(key).Delete(key)
+}
+
+// Range calls f sequentially for each key and value present in the map,
+// shard by shard. Range makes no guarantee about the order keys are visited
+// in across shards, and within a shard it visits entries in that shard's
+// StringMap's own hash order, not key order - see StringMap.RangeFrom; use
+// Map[string, V] if you need an actual ascending-by-key order.
+//
+// If f returns false, Range stops the iteration.
+func (s *ShardedString) Range(f func(key string, value interface{}) bool) {
+	for _, shard := range s.shards {
+		stop := false
+		shard.Range(func(key string, value interface{}) bool {
+			if !f(key, value) {
+				stop = true
+				return false
+			}
+			return true
+		})
+		if stop {
+			break
+		}
+	}
+}
+
+// Len returns the total number of entries across all shards.
+func (s *ShardedString) Len() int {
+	total := 0
+	for _, shard := range s.shards {
+		total += shard.Len()
+	}
+	return total
+}
+
+// hashInt64 mixes x into a well-distributed 64-bit value, so that nearby or
+// sequential keys (a common case for int64 keys, e.g. auto-incrementing IDs)
+// still spread evenly across shards. This is the splitmix64 finalizer.
+func hashInt64(x int64) uint64 {
+	h := uint64(x)
+	h = (h ^ (h >> 30)) * 0xbf58476d1ce4e5b9
+	h = (h ^ (h >> 27)) * 0x94d049bb133111eb
+	return h ^ (h >> 31)
+}
+
+// ShardedInt64 is the int64-keyed counterpart to ShardedString: a fixed
+// number of independent Map[int64, interface{}] instances, dispatched by a
+// hash of the key rather than the key's own order, for the same reason
+// ShardedString shards a StringMap - so concurrent writers to different keys
+// rarely contend on the same skip list header.
+type ShardedInt64 struct {
+	shift  uint
+	shards []*Map[int64, interface{}]
+}
+
+// NewShardedInt64 returns a ShardedInt64 with at least `shards` inner Map
+// instances, rounded up to the next power of two for the same bit-shift
+// dispatch as NewShardedString.
+func NewShardedInt64(shards int) *ShardedInt64 {
+	if shards < 1 {
+		shards = 1
+	}
+	k := 0
+	for (1 << k) < shards {
+		k++
+	}
+	si := &ShardedInt64{
+		shift:  64 - uint(k),
+		shards: make([]*Map[int64, interface{}], 1<<k),
+	}
+	for i := range si.shards {
+		si.shards[i] = NewMap[int64, interface{}]()
+	}
+	return si
+}
+
+// shardFor returns the inner Map that owns key.
+func (s *ShardedInt64) shardFor(key int64) *Map[int64, interface{}] {
+	return s.shards[hashInt64(key)>>s.shift]
+}
+
+// Store sets the value for a key.
+func (s *ShardedInt64) Store(key int64, value interface{}) {
+	s.shardFor(key).Store(key, value)
+}
+
+// Load returns the value stored in the map for a key, or nil if no
+// value is present.
+// The ok result indicates whether value was found in the map.
+func (s *ShardedInt64) Load(key int64) (value interface{}, ok bool) {
+	return s.shardFor(key).Load(key)
+}
+
+// LoadOrStore returns the existing value for the key if present.
+// Otherwise, it stores and returns the given value.
+// The loaded result is true if the value was loaded, false if stored.
+func (s *ShardedInt64) LoadOrStore(key int64, value interface{}) (actual interface{}, loaded bool) {
+	return s.shardFor(key).LoadOrStore(key, value)
+}
+
+// LoadAndDelete deletes the value for a key, returning the previous value if any.
+// The loaded result reports whether the key was present.
+func (s *ShardedInt64) LoadAndDelete(key int64) (value interface{}, loaded bool) {
+	return s.shardFor(key).LoadAndDelete(key)
+}
+
+// Delete deletes the value for a key.
+func (s *ShardedInt64) Delete(key int64) {
+	s.shardFor(key).Delete(key)
+}
+
+// Range calls f sequentially for each key and value present in the map,
+// shard by shard. Range makes no guarantee about the order keys are visited
+// in across shards, only that each shard is visited in its own ascending
+// key order.
+//
+// If f returns false, Range stops the iteration.
+func (s *ShardedInt64) Range(f func(key int64, value interface{}) bool) {
+	for _, shard := range s.shards {
+		stop := false
+		shard.Range(func(key int64, value interface{}) bool {
+			if !f(key, value) {
+				stop = true
+				return false
+			}
+			return true
+		})
+		if stop {
+			break
+		}
+	}
+}
+
+// Len returns the total number of entries across all shards.
+func (s *ShardedInt64) Len() int {
+	total := 0
+	for _, shard := range s.shards {
+		total += shard.Len()
+	}
+	return total
+}
@@ -0,0 +1,78 @@
+// Copyright 2021 ByteDance Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package skipmap
+
+import (
+	"testing"
+	"time"
+)
+
+// TestStoreAfterDeleteWithOpenSnapshot reproduces the reported hang: Delete
+// a key while a snapshot is open pins it as a tombstone, and a subsequent
+// Store for the same key used to busy-spin forever, since nothing short of
+// closing every open snapshot ever unlinked it. Once the snapshot that
+// predates the delete is closed, Store must be able to make progress even
+// with sn still open, since sn was taken after the delete and so never
+// needed this key's old value.
+func TestStoreAfterDeleteWithOpenSnapshot(t *testing.T) {
+	s := NewString()
+	s.Store("k", "v1")
+
+	older := s.Snapshot() // opened before the delete below, so it pins the tombstone
+	s.Delete("k")
+
+	sn := s.Snapshot() // opened after the delete, irrelevant to key "k"
+	defer sn.Close()
+	older.Close()
+
+	done := make(chan struct{})
+	go func() {
+		s.Store("k", "v2")
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Store blocked on a pinned tombstone with an unrelated snapshot open")
+	}
+
+	v, ok := s.Load("k")
+	if !ok || v != "v2" {
+		t.Fatalf("Load(%q) = %v, %v; want v2, true", "k", v, ok)
+	}
+}
+
+// TestSnapshotSeesDeletedValueUntilClosed checks the fix above didn't
+// regress the actual point of a tombstone: a snapshot taken before a delete
+// must keep seeing the old value for as long as it stays open.
+func TestSnapshotSeesDeletedValueUntilClosed(t *testing.T) {
+	s := NewString()
+	s.Store("k", "v1")
+
+	sn := s.Snapshot()
+	s.Delete("k")
+
+	v, ok := sn.Load("k")
+	if !ok || v != "v1" {
+		t.Fatalf("sn.Load(%q) = %v, %v; want v1, true", "k", v, ok)
+	}
+
+	if _, ok := s.Load("k"); ok {
+		t.Fatalf("s.Load(%q) after Delete = _, true; want false", "k")
+	}
+
+	sn.Close()
+}
@@ -15,6 +15,7 @@
 package skipmap
 
 import (
+	"runtime"
 	"sync"
 	"sync/atomic"
 	"unsafe"
@@ -28,8 +29,17 @@ func hash(s string) uint64 {
 
 // StringMap represents a map based on skip list in ascending order.
 type StringMap struct {
-	header *stringNode
-	length int64
+	header  *stringNode
+	length  int64
+	snapSeq uint64 // monotonic counter, bumped on every insert and every tombstoning delete, and read by Snapshot
+	// snapshots holds the set of *StringSnapshot currently outstanding, so
+	// Delete/LoadAndDelete/CompareAndDelete know whether they must keep a
+	// tombstone around instead of physically unlinking a node.
+	snapshots sync.Map
+	// bloom is a *stringBloom, or nil when no filter is attached. It is
+	// read/written atomically so DisableBloom can turn it off without
+	// synchronizing with concurrent Store/Load calls.
+	bloom unsafe.Pointer
 }
 
 type stringNode struct {
@@ -37,8 +47,19 @@ type stringNode struct {
 	score uint64
 	value unsafe.Pointer
 	next  []*stringNode
-	mu    sync.Mutex
-	flags bitflag
+	// prev is the level-0 backward link, maintained alongside next[0] so that
+	// ReverseRange and Iterator.Prev can walk the map without re-searching
+	// from the header.
+	prev unsafe.Pointer
+	mu   sync.Mutex
+	// seq is the snapSeq value at the time this node was inserted.
+	// delSeq is the snapSeq value at the time this node was left behind as
+	// a tombstone for an open snapshot, or 0 if it never was (a live node,
+	// or one deleted while no snapshot was open). Both are read by
+	// StringSnapshot to decide whether a node is visible as of a given seq.
+	seq    uint64
+	delSeq uint64
+	flags  bitflag
 }
 
 func newStringNode(key string, value interface{}, level int) *stringNode {
@@ -51,6 +72,16 @@ func newStringNode(key string, value interface{}, level int) *stringNode {
 	return n
 }
 
+// loadPrev returns `n.prev`(atomic)
+func (n *stringNode) loadPrev() *stringNode {
+	return (*stringNode)(atomic.LoadPointer(&n.prev))
+}
+
+// storePrev same with `n.prev = value`(atomic)
+func (n *stringNode) storePrev(value *stringNode) {
+	atomic.StorePointer(&n.prev, unsafe.Pointer(value))
+}
+
 func (n *stringNode) storeVal(value interface{}) {
 	atomic.StorePointer(&n.value, unsafe.Pointer(&value))
 }
@@ -135,13 +166,7 @@ func (s *StringMap) findNodeDelete(key string, preds *[maxLevel]*stringNode, suc
 }
 
 func unlockString(preds [maxLevel]*stringNode, highestLevel int) {
-	var prevPred *stringNode
-	for i := highestLevel; i >= 0; i-- {
-		if preds[i] != prevPred { // the node could be unlocked by previous loop
-			preds[i].mu.Unlock()
-			prevPred = preds[i]
-		}
-	}
+	unlockNodes(preds, highestLevel, func(n *stringNode) { n.mu.Unlock() })
 }
 
 // Store sets the value for a key.
@@ -158,8 +183,20 @@ func (s *StringMap) Store(key string, value interface{}) {
 				nodeFound.storeVal(value)
 				return
 			}
-			// If the node is marked, represents some other goroutines is in the process of deleting this node,
-			// we need to add this node in next loop.
+			// The node is marked. Either another goroutine is in the middle of
+			// deleting it (delSeq not set yet), or it's a tombstone pinned by
+			// Delete for an open snapshot (delSeq set). Spinning on a plain
+			// continue here would busy-loop until every snapshot on the whole
+			// map closes, including ones opened after this delete and
+			// unrelated to this key - reclaim() already knows how to tell a
+			// still-needed tombstone from a stale one, so give it a chance to
+			// unlink this node before we retry, and back off briefly for the
+			// transient no-delSeq-yet case.
+			if atomic.LoadUint64(&nodeFound.delSeq) != 0 {
+				s.reclaim()
+			} else {
+				runtime.Gosched()
+			}
 			continue
 		}
 
@@ -189,13 +226,47 @@ func (s *StringMap) Store(key string, value interface{}) {
 		}
 
 		nn := newStringNode(key, value, level)
+		nn.seq = s.nextSeq()
+		// Record the key in the bloom filter before the node is linked into
+		// the list below. A concurrent Load consults the filter first and
+		// trusts a miss as definitive, so the bit must already be set by the
+		// time the node becomes reachable - adding it after linking (or after
+		// unlocking) leaves a window where Load can see "not present" for a
+		// key that is already live.
+		//
+		// b.mu's read side stays held from here until nn is fully linked
+		// below, not just across setting the bits: maybeResizeBloom rebuilds
+		// its bit array from a fresh s.Range under the write side of this
+		// same lock, and that Range only ever sees fully-linked nodes. If we
+		// released the read lock right after add(), a resize could squeeze
+		// in between add() setting this key's bit and nn actually becoming
+		// visible to Range, rebuild newBits without this key, and then
+		// replace b.bits wholesale - permanently losing a bit for a key that
+		// is already live. Holding the lock across linking rules that out:
+		// the resize's write lock can't be acquired until nn is visible.
+		b := s.loadBloom()
+		if b != nil {
+			b.mu.RLock()
+			b.addLocked(key)
+		}
 		for layer := 0; layer < level; layer++ {
 			nn.next[layer] = succs[layer]
 			preds[layer].storeNext(layer, nn)
 		}
+		// Thread the level-0 backward link. preds[0] is always locked above
+		// (layer 0 is always within [0, level)), so this is safe.
+		nn.storePrev(preds[0])
+		if succs[0] != nil {
+			succs[0].storePrev(nn)
+		}
 		nn.flags.SetTrue(fullyLinked)
 		unlockString(preds, highestLocked)
 		atomic.AddInt64(&s.length, 1)
+		if b != nil {
+			b.mu.RUnlock()
+			atomic.AddUint64(&b.inserted, 1)
+			s.maybeResizeBloom(b)
+		}
 	}
 }
 
@@ -203,6 +274,9 @@ func (s *StringMap) Store(key string, value interface{}) {
 // value is present.
 // The ok result indicates whether value was found in the map.
 func (s *StringMap) Load(key string) (value interface{}, ok bool) {
+	if b := s.loadBloom(); b != nil && !b.mayContain(key) {
+		return nil, false
+	}
 	score := hash(key)
 	x := s.header
 	for i := maxLevel - 1; i >= 0; i-- {
@@ -248,6 +322,16 @@ func (s *StringMap) LoadAndDelete(key string) (value interface{}, loaded bool) {
 				}
 				nodeToDelete.flags.SetTrue(marked)
 				isMarked = true
+				if s.hasLiveSnapshot() {
+					// A snapshot could still observe this node's old value, so keep
+					// it in the chain as a tombstone instead of unlinking it now;
+					// reclaim() will unlink it once no snapshot can see it anymore.
+					atomic.StoreUint64(&nodeToDelete.delSeq, s.nextSeq())
+					val := nodeToDelete.loadVal()
+					nodeToDelete.mu.Unlock()
+					atomic.AddInt64(&s.length, -1)
+					return val, true
+				}
 			}
 			// Accomplish the physical deletion.
 			var (
@@ -278,6 +362,9 @@ func (s *StringMap) LoadAndDelete(key string) (value interface{}, loaded bool) {
 				// So we don't need `nodeToDelete.loadNext`
 				preds[i].storeNext(i, nodeToDelete.next[i])
 			}
+			if next0 := nodeToDelete.next[0]; next0 != nil {
+				next0.storePrev(preds[0])
+			}
 			nodeToDelete.mu.Unlock()
 			unlockString(preds, highestLocked)
 			atomic.AddInt64(&s.length, -1)
@@ -299,6 +386,102 @@ func (s *StringMap) LoadOrStore(key string, value interface{}) (actual interface
 	return loadedval, true
 }
 
+// compareAndSwapVal swaps the node's value from old to new if its current
+// value equals old. The node's mutex (also used to serialize linking/marking)
+// doubles as the value lock here, since the boxed value is replaced wholesale
+// rather than compared atomically.
+func (n *stringNode) compareAndSwapVal(old, new interface{}) bool {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.flags.Get(marked) || n.loadVal() != old {
+		return false
+	}
+	n.storeVal(new)
+	return true
+}
+
+// CompareAndSwap swaps the old and new values for key
+// if the value stored in the map is equal to old.
+// It returns false if no value is stored for key, or the stored value is not
+// equal to old.
+func (s *StringMap) CompareAndSwap(key string, old, new interface{}) bool {
+	var preds, succs [maxLevel]*stringNode
+	node := s.findNode(key, &preds, &succs)
+	if node == nil || !node.flags.MGet(fullyLinked|marked, fullyLinked) {
+		return false
+	}
+	return node.compareAndSwapVal(old, new)
+}
+
+// CompareAndDelete deletes the entry for key if its value is equal to old.
+// It returns false if no value is stored for key, or the stored value is not
+// equal to old.
+func (s *StringMap) CompareAndDelete(key string, old interface{}) bool {
+	var (
+		nodeToDelete *stringNode
+		isMarked     bool // represents if this operation mark the node
+		topLayer     = -1
+		preds, succs [maxLevel]*stringNode
+	)
+	for {
+		lFound := s.findNodeDelete(key, &preds, &succs)
+		if isMarked ||
+			lFound != -1 && succs[lFound].flags.MGet(fullyLinked|marked, fullyLinked) && (len(succs[lFound].next)-1) == lFound {
+			if !isMarked {
+				nodeToDelete = succs[lFound]
+				topLayer = lFound
+				nodeToDelete.mu.Lock()
+				if nodeToDelete.flags.Get(marked) {
+					nodeToDelete.mu.Unlock()
+					return false
+				}
+				if nodeToDelete.loadVal() != old {
+					nodeToDelete.mu.Unlock()
+					return false
+				}
+				nodeToDelete.flags.SetTrue(marked)
+				isMarked = true
+				if s.hasLiveSnapshot() {
+					atomic.StoreUint64(&nodeToDelete.delSeq, s.nextSeq())
+					nodeToDelete.mu.Unlock()
+					atomic.AddInt64(&s.length, -1)
+					return true
+				}
+			}
+			// Accomplish the physical deletion.
+			var (
+				highestLocked        = -1 // the highest level being locked by this process
+				valid                = true
+				pred, succ, prevPred *stringNode
+			)
+			for layer := 0; valid && (layer <= topLayer); layer++ {
+				pred, succ = preds[layer], succs[layer]
+				if pred != prevPred { // the node in this layer could be locked by previous loop
+					pred.mu.Lock()
+					highestLocked = layer
+					prevPred = pred
+				}
+				valid = !pred.flags.Get(marked) && pred.loadNext(layer) == succ
+			}
+			if !valid {
+				unlockString(preds, highestLocked)
+				continue
+			}
+			for i := topLayer; i >= 0; i-- {
+				preds[i].storeNext(i, nodeToDelete.next[i])
+			}
+			if next0 := nodeToDelete.next[0]; next0 != nil {
+				next0.storePrev(preds[0])
+			}
+			nodeToDelete.mu.Unlock()
+			unlockString(preds, highestLocked)
+			atomic.AddInt64(&s.length, -1)
+			return true
+		}
+		return false
+	}
+}
+
 // Delete deletes the value for a key.
 func (s *StringMap) Delete(key string) {
 	var (
@@ -323,6 +506,12 @@ func (s *StringMap) Delete(key string) {
 				}
 				nodeToDelete.flags.SetTrue(marked)
 				isMarked = true
+				if s.hasLiveSnapshot() {
+					atomic.StoreUint64(&nodeToDelete.delSeq, s.nextSeq())
+					nodeToDelete.mu.Unlock()
+					atomic.AddInt64(&s.length, -1)
+					return // true, tombstoned
+				}
 			}
 			// Accomplish the physical deletion.
 			var (
@@ -353,6 +542,9 @@ func (s *StringMap) Delete(key string) {
 				// So we don't need `nodeToDelete.loadNext`
 				preds[i].storeNext(i, nodeToDelete.next[i])
 			}
+			if next0 := nodeToDelete.next[0]; next0 != nil {
+				next0.storePrev(preds[0])
+			}
 			nodeToDelete.mu.Unlock()
 			unlockString(preds, highestLocked)
 			atomic.AddInt64(&s.length, -1)
@@ -0,0 +1,204 @@
+// Copyright 2021 ByteDance Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package skipmap
+
+// seekNode returns the first fully-linked, non-marked node whose (score, key)
+// is >= (hash(key), key) in the map's own level-0 order, or nil if there is
+// none. Since that order is primarily by hash(key), not by key (see the
+// note on RangeFrom), this is "the first entry at or after
+// where key would sort in hash order", not "the first entry with a key >=
+// key" in any lexical sense.
+func (s *StringMap) seekNode(key string) *stringNode {
+	score := hash(key)
+	x := s.header
+	for i := maxLevel - 1; i >= 0; i-- {
+		nex := x.loadNext(i)
+		for nex != nil && nex.cmp(score, key) < 0 {
+			x = nex
+			nex = x.loadNext(i)
+		}
+		if nex != nil && nex.cmp(score, key) == 0 {
+			x = nex
+			break
+		}
+		if i == 0 {
+			x = nex
+		}
+	}
+	for x != nil && !x.flags.MGet(fullyLinked|marked, fullyLinked) {
+		x = x.loadNext(0)
+	}
+	return x
+}
+
+// RangeFrom calls f sequentially for each key and value present in the
+// skipmap, starting from the first entry at or after startKey and
+// continuing in the map's own level-0 order.
+//
+// That order is primarily by hash(key) - stringNode.cmp only falls back to
+// comparing keys lexically to break ties between hash collisions - so this
+// is not a lexical range scan: it resumes from wherever startKey's hash
+// happens to sort, and visits entries in hash order from there, the same
+// way HashedMap.Range visits entries in hash order rather than key order.
+// Nothing here is ordered by key; use Map[string, V] instead if you need an
+// actual ascending-by-key range.
+//
+// If f returns false, RangeFrom stops the iteration. RangeFrom carries the
+// same consistency caveats as Range.
+func (s *StringMap) RangeFrom(startKey string, f func(key string, value interface{}) bool) {
+	x := s.seekNode(startKey)
+	for x != nil {
+		if !x.flags.MGet(fullyLinked|marked, fullyLinked) {
+			x = x.loadNext(0)
+			continue
+		}
+		if !f(x.key, x.loadVal()) {
+			break
+		}
+		x = x.loadNext(0)
+	}
+}
+
+// RangeBetween calls f sequentially for each entry from the first one at or
+// after lo through the last one at or before hi, in the map's own hash
+// order - see RangeFrom. Despite the names, this is not "every key between
+// lo and hi": lo and hi bound a range of hash(key) values, which has no
+// relationship to the lexical range between the two strings, so this can
+// both skip keys a caller would expect in range and include ones they
+// wouldn't. Use Map[string, V] instead if you need a real lexical range.
+//
+// If f returns false, RangeBetween stops the iteration. RangeBetween
+// carries the same consistency caveats as Range.
+func (s *StringMap) RangeBetween(lo, hi string, f func(key string, value interface{}) bool) {
+	hiScore := hash(hi)
+	x := s.seekNode(lo)
+	for x != nil {
+		if !x.flags.MGet(fullyLinked|marked, fullyLinked) {
+			x = x.loadNext(0)
+			continue
+		}
+		if x.cmp(hiScore, hi) > 0 {
+			break
+		}
+		if !f(x.key, x.loadVal()) {
+			break
+		}
+		x = x.loadNext(0)
+	}
+}
+
+// ReverseRange calls f sequentially for each key and value present in the
+// skipmap in the reverse of the map's own hash order - see RangeFrom; this
+// is not descending key order. If f returns false, ReverseRange stops the
+// iteration.
+//
+// ReverseRange walks the level-0 backward links, so it costs one initial
+// forward pass to reach the tail.
+func (s *StringMap) ReverseRange(f func(key string, value interface{}) bool) {
+	x := s.header.loadNext(0)
+	if x == nil {
+		return
+	}
+	var tail *stringNode
+	for x != nil {
+		if x.flags.MGet(fullyLinked|marked, fullyLinked) {
+			tail = x
+		}
+		x = x.loadNext(0)
+	}
+	for tail != nil && tail != s.header {
+		if !tail.flags.MGet(fullyLinked|marked, fullyLinked) {
+			tail = tail.loadPrev()
+			continue
+		}
+		if !f(tail.key, tail.loadVal()) {
+			break
+		}
+		tail = tail.loadPrev()
+	}
+}
+
+// StringIterator walks a StringMap's entries in the map's own hash order -
+// see RangeFrom; despite the name, this is not key order. It is built on
+// top of the level-0 doubly-linked chain, so Next and Prev are both O(1)
+// once positioned.
+//
+// A StringIterator does not hold a lock: like Range, it observes whatever
+// mapping was live at the time each node was visited, not a single consistent
+// snapshot.
+type StringIterator struct {
+	s   *StringMap
+	cur *stringNode
+}
+
+// NewIterator returns a StringIterator that is not positioned at any entry:
+// Valid reports false, and Next and Prev leave it unpositioned and return
+// false. Callers must call Seek before reading Key/Value.
+func (s *StringMap) NewIterator() *StringIterator {
+	return &StringIterator{s: s}
+}
+
+// Seek positions the iterator at the first entry at or after key in the
+// map's own hash order - see RangeFrom. It returns the same value as a
+// subsequent call to Valid.
+func (it *StringIterator) Seek(key string) bool {
+	it.cur = it.s.seekNode(key)
+	return it.Valid()
+}
+
+// Valid reports whether the iterator is positioned at an entry.
+func (it *StringIterator) Valid() bool {
+	return it.cur != nil
+}
+
+// Key returns the key at the iterator's current position.
+// Key panics if the iterator is not Valid.
+func (it *StringIterator) Key() string {
+	return it.cur.key
+}
+
+// Value returns the value at the iterator's current position.
+// Value panics if the iterator is not Valid.
+func (it *StringIterator) Value() interface{} {
+	return it.cur.loadVal()
+}
+
+// Next advances the iterator to the next entry in the map's own hash order -
+// see RangeFrom. It returns the same value as a subsequent call to Valid.
+func (it *StringIterator) Next() bool {
+	for it.cur != nil {
+		it.cur = it.cur.loadNext(0)
+		if it.cur != nil && it.cur.flags.MGet(fullyLinked|marked, fullyLinked) {
+			break
+		}
+	}
+	return it.Valid()
+}
+
+// Prev moves the iterator to the previous entry in the map's own hash order -
+// see RangeFrom. It returns the same value as a subsequent call to Valid.
+func (it *StringIterator) Prev() bool {
+	for it.cur != nil {
+		it.cur = it.cur.loadPrev()
+		if it.cur != nil && it.cur == it.s.header {
+			it.cur = nil
+			break
+		}
+		if it.cur != nil && it.cur.flags.MGet(fullyLinked|marked, fullyLinked) {
+			break
+		}
+	}
+	return it.Valid()
+}
@@ -0,0 +1,171 @@
+// Copyright 2021 ByteDance Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package skipmap
+
+import (
+	"sort"
+	"strconv"
+	"testing"
+)
+
+// mapOrderKeys returns ks sorted the same way StringMap's level-0 chain
+// really orders them: by hash(key) first, falling back to the key itself
+// only to break a hash collision. This is the "true" order RangeFrom,
+// RangeBetween, ReverseRange and StringIterator walk in - not key order.
+func mapOrderKeys(ks []string) []string {
+	out := append([]string(nil), ks...)
+	sort.Slice(out, func(i, j int) bool {
+		hi, hj := hash(out[i]), hash(out[j])
+		if hi != hj {
+			return hi < hj
+		}
+		return out[i] < out[j]
+	})
+	return out
+}
+
+func someKeys(n int) []string {
+	ks := make([]string, n)
+	for i := range ks {
+		ks[i] = "key" + strconv.Itoa(i)
+	}
+	return ks
+}
+
+// TestRangeFromFollowsHashOrderNotKeyOrder documents and pins down the
+// actual contract: RangeFrom walks entries in (hash(key), key) order, which
+// is generally unrelated to lexical key order. A caller expecting ascending
+// *key* order from this method is relying on a false doc comment that has
+// since been corrected.
+func TestRangeFromFollowsHashOrderNotKeyOrder(t *testing.T) {
+	s := NewString()
+	keys := someKeys(50)
+	for _, k := range keys {
+		s.Store(k, k)
+	}
+
+	want := mapOrderKeys(keys)
+	// Start from the very first entry in the map's own order.
+	var got []string
+	s.RangeFrom(want[0], func(key string, _ interface{}) bool {
+		got = append(got, key)
+		return true
+	})
+
+	if len(got) != len(want) {
+		t.Fatalf("RangeFrom visited %d entries; want %d", len(got), len(want))
+	}
+	for i, k := range got {
+		if k != want[i] {
+			t.Fatalf("RangeFrom[%d] = %q; want %q (map's hash order, not key order)", i, k, want[i])
+		}
+	}
+}
+
+// TestRangeBetweenIsHashRangeNotLexicalRange finds a pair of keys whose
+// lexical order disagrees with their hash order (guaranteed to exist for a
+// large enough sample, since hash(key) has no relationship to key) and
+// shows RangeBetween follows the hash order, not the lexical range its name
+// and old doc comment implied.
+func TestRangeBetweenIsHashRangeNotLexicalRange(t *testing.T) {
+	keys := someKeys(200)
+	var lo, hi string
+	found := false
+	for i := 0; i < len(keys) && !found; i++ {
+		for j := 0; j < len(keys); j++ {
+			a, b := keys[i], keys[j]
+			if a < b && hash(a) > hash(b) {
+				lo, hi = a, b
+				found = true
+				break
+			}
+		}
+	}
+	if !found {
+		t.Skip("no lexical/hash order disagreement found in this sample")
+	}
+
+	s := NewString()
+	for _, k := range keys {
+		s.Store(k, k)
+	}
+
+	var got []string
+	s.RangeBetween(lo, hi, func(key string, _ interface{}) bool {
+		got = append(got, key)
+		return true
+	})
+
+	// lo > hi in hash order (that's how we picked them), so the hash-order
+	// walk starting at lo immediately exceeds hi and stops right away -
+	// exactly the kind of result a caller expecting a lexical [lo, hi] scan
+	// would not expect, and the reason the doc comment no longer promises
+	// "every key between lo and hi".
+	if len(got) != 0 {
+		t.Fatalf("RangeBetween(%q, %q) = %v; want empty, since hash(%q) > hash(%q) even though %q < %q lexically",
+			lo, hi, got, lo, hi, lo, hi)
+	}
+}
+
+func TestReverseRangeIsReverseOfHashOrder(t *testing.T) {
+	s := NewString()
+	keys := someKeys(50)
+	for _, k := range keys {
+		s.Store(k, k)
+	}
+	want := mapOrderKeys(keys)
+
+	var got []string
+	s.ReverseRange(func(key string, _ interface{}) bool {
+		got = append(got, key)
+		return true
+	})
+
+	if len(got) != len(want) {
+		t.Fatalf("ReverseRange visited %d entries; want %d", len(got), len(want))
+	}
+	for i, k := range got {
+		if k != want[len(want)-1-i] {
+			t.Fatalf("ReverseRange[%d] = %q; want %q (reverse of the map's hash order)", i, k, want[len(want)-1-i])
+		}
+	}
+}
+
+func TestStringIteratorFollowsHashOrder(t *testing.T) {
+	s := NewString()
+	keys := someKeys(50)
+	for _, k := range keys {
+		s.Store(k, k)
+	}
+	want := mapOrderKeys(keys)
+
+	it := s.NewIterator()
+	if !it.Seek(want[0]) {
+		t.Fatalf("Seek(%q) = false; want true", want[0])
+	}
+	var got []string
+	for it.Valid() {
+		got = append(got, it.Key())
+		it.Next()
+	}
+	if len(got) != len(want) {
+		t.Fatalf("iterator visited %d entries; want %d", len(got), len(want))
+	}
+	for i, k := range got {
+		if k != want[i] {
+			t.Fatalf("iterator[%d] = %q; want %q (map's hash order, not key order)", i, k, want[i])
+		}
+	}
+}